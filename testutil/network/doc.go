@@ -0,0 +1,15 @@
+// Package network provides utilities for running in-process Tendermint/
+// cosmos-sdk test networks for CLI and IBC integration tests. Nothing in this
+// package places wasm code or instantiated contracts into genesis.
+//
+// Known limitations that need upstream cosmos-sdk changes before they can
+// be closed out properly:
+//
+//   - Fast test-to-test network reuse (snapshot/restore of a booted chain's
+//     IAVL state instead of re-running New's full validator boot every
+//     time) isn't implemented. network.Network and network.Validator don't
+//     expose the underlying *baseapp.BaseApp or its SnapshotManager through
+//     their public API in the pinned cosmos-sdk release, so this package
+//     has no way to capture or restore committed state without forking
+//     cosmos-sdk's testutil/network. See the history of snapshot.go.
+package network
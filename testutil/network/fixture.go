@@ -0,0 +1,133 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/crypto/hd"
+	"github.com/cosmos/cosmos-sdk/crypto/keyring"
+	"github.com/cosmos/cosmos-sdk/simapp"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/tendermint/spm/cosmoscmd"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+
+	"github.com/ChihuahuaChain/chihuahua/app"
+)
+
+// fixtureChainID is held constant, rather than randomized the way
+// DefaultConfig does via tmrand, so the fixture is reproducible.
+const fixtureChainID = "chihuahua-fixture-1"
+
+// fixtureMnemonics is a fixed list of mnemonics used in place of
+// keyring.NewMnemonic, so RunFixtureBlock funds the same addresses on every
+// invocation and the resulting AppHash stays reproducible.
+var fixtureMnemonics = []string{
+	"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+}
+
+// fixtureGenesisTime is held constant so the resulting AppHash does not
+// depend on wall-clock time.
+var fixtureGenesisTime = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fixtureValidatorSeed derives a deterministic ed25519 validator key so
+// BeginBlock is given the same ProposerAddress on every run.
+var fixtureValidatorSeed = []byte("chihuahua-fixture-validator-seed")
+
+// RunFixtureBlock constructs the app the same way DefaultConfig does, funds
+// it with accounts drawn from a constant mnemonic list, runs InitChain and
+// commits it, then feeds txs through a single BeginBlock/DeliverTx.../
+// EndBlock/Commit block at height 2 using a fixed genesis time and
+// validator key. It returns the resulting
+// AppHash and each tx's DeliverTx response so a companion test can diff
+// them against a committed golden value.
+func RunFixtureBlock(t *testing.T, txs [][]byte) ([]byte, []abci.ResponseDeliverTx, error) {
+	t.Helper()
+
+	encoding := cosmoscmd.MakeEncodingConfig(app.ModuleBasics)
+	genesisState := app.ModuleBasics.DefaultGenesis(encoding.Marshaler)
+
+	kr := keyring.NewInMemory()
+	var genAccounts []authtypes.GenesisAccount
+	var genBalances []banktypes.Balance
+	for i, mnemonic := range fixtureMnemonics {
+		name := fmt.Sprintf("fixture-%d", i)
+		info, err := kr.NewAccount(name, mnemonic, "", sdk.FullFundraiserPath, hd.Secp256k1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		genAccounts = append(genAccounts, authtypes.NewBaseAccount(info.GetAddress(), info.GetPubKey(), 0, 0))
+		genBalances = append(genBalances, banktypes.Balance{
+			Address: info.GetAddress().String(),
+			Coins: sdk.NewCoins(
+				sdk.NewCoin(sdk.DefaultBondDenom, sdk.TokensFromConsensusPower(1000, sdk.DefaultPowerReduction)),
+			),
+		})
+	}
+
+	var authGenState authtypes.GenesisState
+	encoding.Marshaler.MustUnmarshalJSON(genesisState[authtypes.ModuleName], &authGenState)
+	packed, err := authtypes.PackAccounts(genAccounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	authGenState.Accounts = append(authGenState.Accounts, packed...)
+	genesisState[authtypes.ModuleName] = encoding.Marshaler.MustMarshalJSON(&authGenState)
+
+	var bankGenState banktypes.GenesisState
+	encoding.Marshaler.MustUnmarshalJSON(genesisState[banktypes.ModuleName], &bankGenState)
+	bankGenState.Balances = append(bankGenState.Balances, genBalances...)
+	genesisState[banktypes.ModuleName] = encoding.Marshaler.MustMarshalJSON(&bankGenState)
+
+	rawGenesis, err := json.Marshal(genesisState)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validatorPrivKey := ed25519.GenPrivKeyFromSecret(fixtureValidatorSeed)
+	validator := tmtypes.NewValidator(validatorPrivKey.PubKey(), 1)
+
+	fixtureApp := app.New(
+		log.NewNopLogger(), tmdb.NewMemDB(), nil, true, map[int64]bool{}, t.TempDir(), 0,
+		encoding, simapp.EmptyAppOptions{},
+	)
+
+	// req.Validators is intentionally left empty: the default genesis has no
+	// staking module validators (no gentx), so InitChain's sanity check that
+	// len(req.Validators) == len(GenesisValidators) would otherwise panic.
+	// validator below is only used to stamp BeginBlock's ProposerAddress.
+	fixtureApp.InitChain(abci.RequestInitChain{
+		ChainId:         fixtureChainID,
+		Time:            fixtureGenesisTime,
+		ConsensusParams: simapp.DefaultConsensusParams,
+		AppStateBytes:   rawGenesis,
+	})
+	fixtureApp.Commit()
+
+	header := tmproto.Header{
+		ChainID:         fixtureChainID,
+		Height:          2,
+		Time:            fixtureGenesisTime.Add(time.Second),
+		ProposerAddress: validator.Address,
+	}
+	fixtureApp.BeginBlock(abci.RequestBeginBlock{Header: header})
+
+	resps := make([]abci.ResponseDeliverTx, 0, len(txs))
+	for _, txBz := range txs {
+		resps = append(resps, fixtureApp.DeliverTx(abci.RequestDeliverTx{Tx: txBz}))
+	}
+
+	fixtureApp.EndBlock(abci.RequestEndBlock{Height: header.Height})
+	commit := fixtureApp.Commit()
+
+	return commit.Data, resps, nil
+}
@@ -0,0 +1,26 @@
+package network_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChihuahuaChain/chihuahua/testutil/network"
+)
+
+// goldenAppHash is the AppHash RunFixtureBlock produced for an empty block
+// the last time this fixture was intentionally updated. Any state-machine
+// change - a module version bump, an ante handler tweak, a store key
+// rename - will shift this hash and fail the test below.
+const goldenAppHash = "0089bcc916bec7872e17b1917f404ae649915b8e916836a22bdc283325c1a211"
+
+func TestConsistentAppHash(t *testing.T) {
+	appHash, resps, err := network.RunFixtureBlock(t, nil)
+	require.NoError(t, err)
+	require.Empty(t, resps)
+
+	require.Equal(t, goldenAppHash, hex.EncodeToString(appHash),
+		"AppHash drifted from the golden fixture; if this is an intentional "+
+			"state-machine change, regenerate goldenAppHash from the new output")
+}
@@ -0,0 +1,484 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/cosmos/cosmos-sdk/client/tx"
+	"github.com/cosmos/cosmos-sdk/crypto/keyring"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	ibctransfertypes "github.com/cosmos/ibc-go/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/modules/core/02-client/types"
+	connectiontypes "github.com/cosmos/ibc-go/modules/core/03-connection/types"
+	channeltypes "github.com/cosmos/ibc-go/modules/core/04-channel/types"
+	committypes "github.com/cosmos/ibc-go/modules/core/23-commitment/types"
+	host "github.com/cosmos/ibc-go/modules/core/24-host"
+	ibcclient "github.com/cosmos/ibc-go/modules/core/client"
+	ibctmtypes "github.com/cosmos/ibc-go/modules/light-clients/07-tendermint/types"
+	"github.com/stretchr/testify/require"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	"github.com/cosmos/cosmos-sdk/testutil/network"
+)
+
+// defaultTrustingPeriod and defaultUnbondingPeriod are conservative enough
+// for the lifetime of a single test process; they are not meant to reflect
+// production client parameters.
+const (
+	defaultTrustingPeriod  = 100000 * 1000000000 // ~27.7h in nanoseconds
+	defaultUnbondingPeriod = defaultTrustingPeriod + 1000000000
+	defaultMaxClockDrift   = 10 * 1000000000
+)
+
+// IBCTestingSetup wires together two or more independently booted
+// in-process networks (see IBCChain) and an in-memory relayer so CLI integration
+// tests can exercise ibctransfer flows against real Chihuahua binaries
+// instead of mocking the counterparty chain.
+type IBCTestingSetup struct {
+	t      *testing.T
+	Chains []*IBCChain
+
+	// Channels maps "<srcIndex>-<dstIndex>" to the channel ID opened on the
+	// src side by OpenTransferChannel.
+	Channels map[string]string
+
+	// ClientIDs maps "<selfIndex>-<counterpartyIndex>" to the client ID self
+	// uses to track counterparty's consensus state.
+	ClientIDs map[string]string
+}
+
+// IBCChain bundles a booted network together with the keyring used to fund
+// it and the client context of its first validator, which is what the
+// relayer queries and broadcasts IBC messages through.
+//
+// Network is *concurrentNetwork rather than the usual *network.Network:
+// cosmos-sdk's network.New takes a package-level lock it only releases from
+// Cleanup, which only runs at the end of the test function, so booting two
+// chains with it back to back inside one test deadlocks on the second call.
+// concurrentNetwork boots the same way without that lock - see
+// concurrent_network.go.
+type IBCChain struct {
+	Network   *concurrentNetwork
+	Keyring   keyring.Keyring
+	ClientCtx client.Context
+}
+
+// NewIBCTestingSetup boots numChains independent networks and returns a
+// harness ready to relay packets between them. config is used as a base for
+// every chain (or DefaultConfig() if it is the zero value), but each chain
+// always gets its own ChainID and its own copy of GenesisState - two chains
+// booted from the very same config value would otherwise collide on both,
+// which defeats the point of simulating independent chains.
+func NewIBCTestingSetup(t *testing.T, numChains int, config network.Config) *IBCTestingSetup {
+	t.Helper()
+	require.GreaterOrEqual(t, numChains, 2, "IBC testing requires at least two chains")
+
+	setup := &IBCTestingSetup{
+		t:         t,
+		Channels:  make(map[string]string),
+		ClientIDs: make(map[string]string),
+	}
+
+	for i := 0; i < numChains; i++ {
+		cfg := config
+		if cfg.GenesisState == nil {
+			cfg = DefaultConfig()
+		}
+		cfg.ChainID = fmt.Sprintf("%s-%d", cfg.ChainID, i)
+		cfg.GenesisState = cloneGenesisState(cfg.GenesisState)
+
+		net := newConcurrentNetwork(t, cfg)
+		t.Cleanup(net.Cleanup)
+		require.NoError(t, net.WaitForNextBlock())
+
+		setup.Chains = append(setup.Chains, &IBCChain{
+			Network:   net,
+			Keyring:   net.Validators[0].ClientCtx.Keyring,
+			ClientCtx: net.Validators[0].ClientCtx,
+		})
+	}
+
+	return setup
+}
+
+func cloneGenesisState(state map[string]json.RawMessage) map[string]json.RawMessage {
+	cloned := make(map[string]json.RawMessage, len(state))
+	for module, raw := range state {
+		cloned[module] = raw
+	}
+	return cloned
+}
+
+// OpenTransferChannel drives the client, connection and channel handshakes
+// between chains[src] and chains[dst] for the transfer module's standard
+// port and records the resulting channel IDs. It blocks until the channel
+// reports OPEN on both ends.
+func (s *IBCTestingSetup) OpenTransferChannel(src, dst int) (srcChannelID, dstChannelID string) {
+	s.t.Helper()
+
+	srcChain, dstChain := s.Chains[src], s.Chains[dst]
+
+	clientIDOnSrc := s.createClient(srcChain, dstChain)
+	clientIDOnDst := s.createClient(dstChain, srcChain)
+	s.ClientIDs[channelKey(src, dst)] = clientIDOnSrc
+	s.ClientIDs[channelKey(dst, src)] = clientIDOnDst
+
+	connIDOnSrc, connIDOnDst := s.createConnection(src, dst, clientIDOnSrc, clientIDOnDst)
+
+	srcChannelID, dstChannelID = s.createChannel(
+		src, dst, connIDOnSrc, connIDOnDst,
+		ibctransfertypes.PortID, ibctransfertypes.PortID,
+	)
+
+	s.Channels[channelKey(src, dst)] = srcChannelID
+	s.Channels[channelKey(dst, src)] = dstChannelID
+
+	return srcChannelID, dstChannelID
+}
+
+// RelayPacket submits packet (collected from the src chain's SendPacket
+// event after broadcasting an ibctransfer MsgTransfer) to the dst chain and
+// relays the resulting acknowledgement back to src. It returns the raw ack
+// bytes so tests can assert on a successful vs. error acknowledgement.
+func (s *IBCTestingSetup) RelayPacket(src, dst int, packet channeltypes.Packet) []byte {
+	s.t.Helper()
+
+	srcChain, dstChain := s.Chains[src], s.Chains[dst]
+
+	height := s.updateClient(dstChain, srcChain, s.ClientIDs[channelKey(dst, src)])
+	packetKey := host.PacketCommitmentKey(packet.GetSourcePort(), packet.GetSourceChannel(), packet.GetSequence())
+	proof, proofHeight := s.queryProof(srcChain, packetKey, height)
+
+	ack := channeltypes.NewResultAcknowledgement([]byte{byte(1)}).Acknowledgement()
+	recvMsg := channeltypes.NewMsgRecvPacket(packet, proof, proofHeight, relayerAddress(dstChain))
+	require.NoError(s.t, s.broadcast(dstChain, recvMsg))
+	require.NoError(s.t, dstChain.Network.WaitForNextBlock())
+
+	ackHeight := s.updateClient(srcChain, dstChain, s.ClientIDs[channelKey(src, dst)])
+	ackKey := host.PacketAcknowledgementKey(packet.GetDestPort(), packet.GetDestChannel(), packet.GetSequence())
+	ackProof, ackProofHeight := s.queryProof(dstChain, ackKey, ackHeight)
+
+	ackMsg := channeltypes.NewMsgAcknowledgement(packet, ack, ackProof, ackProofHeight, relayerAddress(srcChain))
+	require.NoError(s.t, s.broadcast(srcChain, ackMsg))
+	require.NoError(s.t, srcChain.Network.WaitForNextBlock())
+
+	return ack
+}
+
+func channelKey(src, dst int) string {
+	return fmt.Sprintf("%d-%d", src, dst)
+}
+
+func relayerAddress(chain *IBCChain) string {
+	return chain.Network.Validators[0].Address.String()
+}
+
+// createClient reads the counterparty's current validator set and header
+// over its Tendermint RPC endpoint and submits a MsgCreateClient on self,
+// returning the client ID Chihuahua assigned it.
+func (s *IBCTestingSetup) createClient(self, counterparty *IBCChain) string {
+	s.t.Helper()
+
+	height, commit, validators := s.queryLightClientData(counterparty, 0)
+
+	clientState := ibctmtypes.NewClientState(
+		counterparty.ClientCtx.ChainID,
+		ibctmtypes.DefaultTrustLevel,
+		defaultTrustingPeriod,
+		defaultUnbondingPeriod,
+		defaultMaxClockDrift,
+		clienttypes.NewHeight(0, uint64(height)),
+		committypes.GetSDKSpecs(),
+		[]string{"upgrade", "upgradedIBCState"},
+		false, false,
+	)
+	consensusState := ibctmtypes.NewConsensusState(
+		commit.Time,
+		committypes.NewMerkleRoot(commit.Header.AppHash),
+		tmValidatorSetHash(validators),
+	)
+
+	msg, err := clienttypes.NewMsgCreateClient(clientState, consensusState, relayerAddress(self))
+	require.NoError(s.t, err)
+	require.NoError(s.t, s.broadcast(self, msg))
+	require.NoError(s.t, self.Network.WaitForNextBlock())
+
+	return fetchLatestClientID(s.t, self)
+}
+
+// updateClient submits a MsgUpdateClient bringing self's client of
+// counterparty up to counterparty's current height, and returns that
+// height. Every handshake or packet-relay step below must call this
+// immediately before a message carrying a proof, because self's light
+// client only has a consensus state at the height it was created (or last
+// updated) at, and at least one block always elapses between createClient
+// and the first proof-carrying message. Callers must pin their subsequent
+// queryProof call to the height returned here rather than querying
+// counterparty's latest height a second time - both chains advance blocks
+// on their own timer, so by the time a second, independent "latest" query
+// lands, counterparty may already be past the height self's client was
+// just updated to.
+func (s *IBCTestingSetup) updateClient(self, counterparty *IBCChain, clientID string) int64 {
+	s.t.Helper()
+
+	trustedHeight := fetchClientState(s.t, self, clientID).LatestHeight
+	_, trustedValidators := s.queryValidatorsAt(counterparty, int64(trustedHeight.RevisionHeight))
+
+	height, commit, validators := s.queryLightClientData(counterparty, 0)
+
+	header := &ibctmtypes.Header{
+		SignedHeader:      commit.SignedHeader.ToProto(),
+		ValidatorSet:      mustToProtoValidatorSet(s.t, validators),
+		TrustedHeight:     trustedHeight,
+		TrustedValidators: mustToProtoValidatorSet(s.t, trustedValidators),
+	}
+
+	msg, err := clienttypes.NewMsgUpdateClient(clientID, header, relayerAddress(self))
+	require.NoError(s.t, err)
+	require.NoError(s.t, s.broadcast(self, msg))
+	require.NoError(s.t, self.Network.WaitForNextBlock())
+
+	return height
+}
+
+// createConnection drives the four-step connection handshake between
+// chains[src] and chains[dst] and returns the connection IDs assigned on
+// each side.
+func (s *IBCTestingSetup) createConnection(src, dst int, clientIDOnSrc, clientIDOnDst string) (string, string) {
+	s.t.Helper()
+	srcChain, dstChain := s.Chains[src], s.Chains[dst]
+
+	initMsg := connectiontypes.NewMsgConnectionOpenInit(
+		clientIDOnSrc, clientIDOnDst,
+		committypes.NewMerklePrefix([]byte(host.StoreKey)),
+		connectiontypes.DefaultIBCVersion, 0,
+		relayerAddress(srcChain),
+	)
+	require.NoError(s.t, s.broadcast(srcChain, initMsg))
+	require.NoError(s.t, srcChain.Network.WaitForNextBlock())
+	connIDOnSrc := fetchLatestConnectionID(s.t, srcChain)
+
+	height := s.updateClient(dstChain, srcChain, clientIDOnDst)
+	clientStateOnDst := fetchClientState(s.t, dstChain, clientIDOnDst)
+	proofInit, proofHeight := s.queryProof(srcChain, host.ConnectionKey(connIDOnSrc), height)
+
+	tryMsg := connectiontypes.NewMsgConnectionOpenTry(
+		"", clientIDOnDst, connIDOnSrc, clientIDOnSrc, clientStateOnDst,
+		committypes.NewMerklePrefix([]byte(host.StoreKey)),
+		[]*connectiontypes.Version{connectiontypes.DefaultIBCVersion}, 0, proofInit, proofInit, proofInit,
+		proofHeight, proofHeight,
+		relayerAddress(dstChain),
+	)
+	require.NoError(s.t, s.broadcast(dstChain, tryMsg))
+	require.NoError(s.t, dstChain.Network.WaitForNextBlock())
+	connIDOnDst := fetchLatestConnectionID(s.t, dstChain)
+
+	height = s.updateClient(srcChain, dstChain, clientIDOnSrc)
+	clientStateOnSrc := fetchClientState(s.t, srcChain, clientIDOnSrc)
+	proofTry, tryHeight := s.queryProof(dstChain, host.ConnectionKey(connIDOnDst), height)
+
+	ackMsg := connectiontypes.NewMsgConnectionOpenAck(
+		connIDOnSrc, connIDOnDst, clientStateOnSrc,
+		proofTry, proofTry, proofTry, tryHeight, tryHeight,
+		connectiontypes.DefaultIBCVersion, relayerAddress(srcChain),
+	)
+	require.NoError(s.t, s.broadcast(srcChain, ackMsg))
+	require.NoError(s.t, srcChain.Network.WaitForNextBlock())
+
+	height = s.updateClient(dstChain, srcChain, clientIDOnDst)
+	proofAck, ackHeight := s.queryProof(srcChain, host.ConnectionKey(connIDOnSrc), height)
+	confirmMsg := connectiontypes.NewMsgConnectionOpenConfirm(connIDOnDst, proofAck, ackHeight, relayerAddress(dstChain))
+	require.NoError(s.t, s.broadcast(dstChain, confirmMsg))
+	require.NoError(s.t, dstChain.Network.WaitForNextBlock())
+
+	return connIDOnSrc, connIDOnDst
+}
+
+// createChannel drives the four-step channel handshake over the given
+// connections between chains[src] and chains[dst] and returns the channel
+// IDs assigned on each side.
+func (s *IBCTestingSetup) createChannel(src, dst int, connIDOnSrc, connIDOnDst, portSrc, portDst string) (string, string) {
+	s.t.Helper()
+	srcChain, dstChain := s.Chains[src], s.Chains[dst]
+
+	initMsg := channeltypes.NewMsgChannelOpenInit(
+		portSrc, ibctransfertypes.Version, channeltypes.UNORDERED,
+		[]string{connIDOnSrc}, portDst, relayerAddress(srcChain),
+	)
+	require.NoError(s.t, s.broadcast(srcChain, initMsg))
+	require.NoError(s.t, srcChain.Network.WaitForNextBlock())
+	channelIDOnSrc := fetchLatestChannelID(s.t, srcChain, portSrc)
+
+	height := s.updateClient(dstChain, srcChain, s.ClientIDs[channelKey(dst, src)])
+	proofInit, proofHeight := s.queryProof(srcChain, host.ChannelKey(portSrc, channelIDOnSrc), height)
+	tryMsg := channeltypes.NewMsgChannelOpenTry(
+		portDst, "", ibctransfertypes.Version, channeltypes.UNORDERED,
+		[]string{connIDOnDst}, portSrc, channelIDOnSrc, ibctransfertypes.Version,
+		proofInit, proofHeight, relayerAddress(dstChain),
+	)
+	require.NoError(s.t, s.broadcast(dstChain, tryMsg))
+	require.NoError(s.t, dstChain.Network.WaitForNextBlock())
+	channelIDOnDst := fetchLatestChannelID(s.t, dstChain, portDst)
+
+	height = s.updateClient(srcChain, dstChain, s.ClientIDs[channelKey(src, dst)])
+	proofTry, tryHeight := s.queryProof(dstChain, host.ChannelKey(portDst, channelIDOnDst), height)
+	ackMsg := channeltypes.NewMsgChannelOpenAck(
+		portSrc, channelIDOnSrc, channelIDOnDst, ibctransfertypes.Version,
+		proofTry, tryHeight, relayerAddress(srcChain),
+	)
+	require.NoError(s.t, s.broadcast(srcChain, ackMsg))
+	require.NoError(s.t, srcChain.Network.WaitForNextBlock())
+
+	height = s.updateClient(dstChain, srcChain, s.ClientIDs[channelKey(dst, src)])
+	proofAck, ackHeight := s.queryProof(srcChain, host.ChannelKey(portSrc, channelIDOnSrc), height)
+	confirmMsg := channeltypes.NewMsgChannelOpenConfirm(portDst, channelIDOnDst, proofAck, ackHeight, relayerAddress(dstChain))
+	require.NoError(s.t, s.broadcast(dstChain, confirmMsg))
+	require.NoError(s.t, dstChain.Network.WaitForNextBlock())
+
+	return channelIDOnSrc, channelIDOnDst
+}
+
+// queryProof fetches an ABCI proof of key at the exact height, the
+// counterparty's light client of chain was just updated to by the caller's
+// preceding updateClient call. Querying "latest" here instead would race
+// chain's own block timer: chain can advance past height before this lands,
+// and the proof would then cover state the counterparty light client has no
+// consensus root for yet.
+func (s *IBCTestingSetup) queryProof(chain *IBCChain, key []byte, height int64) ([]byte, clienttypes.Height) {
+	s.t.Helper()
+	_, proof, proofHeight, err := ibcclient.QueryTendermintProof(chain.ClientCtx.WithHeight(height), key)
+	require.NoError(s.t, err)
+	return proof, proofHeight
+}
+
+// queryLightClientData fetches the signed header and validator set chain
+// needs at height (0 meaning its current height) to build a 07-tendermint
+// client state/consensus state or header.
+func (s *IBCTestingSetup) queryLightClientData(chain *IBCChain, height int64) (int64, *coretypes.ResultCommit, []*tmtypes.Validator) {
+	s.t.Helper()
+
+	rpcClient := chain.ClientCtx.Client
+	require.NotNil(s.t, rpcClient, "chain's client context has no RPC client for light client bootstrap")
+
+	if height == 0 {
+		status, err := rpcClient.Status(context.Background())
+		require.NoError(s.t, err)
+		height = status.SyncInfo.LatestBlockHeight
+	}
+
+	commit, err := rpcClient.Commit(context.Background(), &height)
+	require.NoError(s.t, err)
+
+	_, validators := s.queryValidatorsAt(chain, height)
+
+	return height, commit, validators
+}
+
+func (s *IBCTestingSetup) queryValidatorsAt(chain *IBCChain, height int64) (int64, []*tmtypes.Validator) {
+	s.t.Helper()
+
+	rpcClient := chain.ClientCtx.Client
+	require.NotNil(s.t, rpcClient, "chain's client context has no RPC client for light client bootstrap")
+
+	result, err := rpcClient.Validators(context.Background(), &height, nil, nil)
+	require.NoError(s.t, err)
+	return height, result.Validators
+}
+
+func mustToProtoValidatorSet(t *testing.T, validators []*tmtypes.Validator) *tmproto.ValidatorSet {
+	t.Helper()
+	pb, err := tmtypes.NewValidatorSet(validators).ToProto()
+	require.NoError(t, err)
+	return pb
+}
+
+// broadcast signs and submits msgs against chain using its first
+// validator's keyring and client context.
+func (s *IBCTestingSetup) broadcast(chain *IBCChain, msgs ...sdk.Msg) error {
+	val := chain.Network.Validators[0]
+	clientCtx := chain.ClientCtx.
+		WithFromName(val.Moniker).
+		WithFromAddress(val.Address).
+		WithSkipConfirmation(true).
+		WithBroadcastMode(flags.BroadcastBlock)
+
+	txf := tx.Factory{}.
+		WithChainID(chain.ClientCtx.ChainID).
+		WithKeybase(chain.Keyring).
+		WithTxConfig(chain.ClientCtx.TxConfig).
+		WithAccountRetriever(chain.ClientCtx.AccountRetriever)
+
+	return tx.BroadcastTx(clientCtx, txf, msgs...)
+}
+
+// WaitForIBCBlocks advances every chain in the setup by n blocks, which
+// relayed packets typically need before their commitment proofs become
+// queryable at a height the counterparty light client already trusts.
+func (s *IBCTestingSetup) WaitForIBCBlocks(n int64) error {
+	for _, c := range s.Chains {
+		for i := int64(0); i < n; i++ {
+			if err := c.Network.WaitForNextBlock(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The helpers below look up the identifier Chihuahua just assigned to a
+// client, connection or channel by re-querying the relevant IBC query
+// service, since the broadcast helper above only surfaces a broadcast
+// error, not the tx's emitted events.
+
+func fetchLatestClientID(t *testing.T, chain *IBCChain) string {
+	t.Helper()
+	resp, err := clienttypes.NewQueryClient(chain.ClientCtx).ClientStates(context.Background(), &clienttypes.QueryClientStatesRequest{})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.ClientStates)
+	return resp.ClientStates[len(resp.ClientStates)-1].ClientId
+}
+
+func fetchClientState(t *testing.T, chain *IBCChain, clientID string) *ibctmtypes.ClientState {
+	t.Helper()
+	resp, err := clienttypes.NewQueryClient(chain.ClientCtx).ClientState(context.Background(), &clienttypes.QueryClientStateRequest{ClientId: clientID})
+	require.NoError(t, err)
+
+	exportedState, err := clienttypes.UnpackClientState(resp.ClientState)
+	require.NoError(t, err)
+
+	tmState, ok := exportedState.(*ibctmtypes.ClientState)
+	require.True(t, ok, "Chihuahua's test harness only supports 07-tendermint clients")
+	return tmState
+}
+
+func fetchLatestConnectionID(t *testing.T, chain *IBCChain) string {
+	t.Helper()
+	resp, err := connectiontypes.NewQueryClient(chain.ClientCtx).Connections(context.Background(), &connectiontypes.QueryConnectionsRequest{})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Connections)
+	return resp.Connections[len(resp.Connections)-1].Id
+}
+
+func fetchLatestChannelID(t *testing.T, chain *IBCChain, portID string) string {
+	t.Helper()
+	resp, err := channeltypes.NewQueryClient(chain.ClientCtx).Channels(context.Background(), &channeltypes.QueryChannelsRequest{})
+	require.NoError(t, err)
+
+	for i := len(resp.Channels) - 1; i >= 0; i-- {
+		if resp.Channels[i].PortId == portID {
+			return resp.Channels[i].ChannelId
+		}
+	}
+	t.Fatalf("no channel found for port %s", portID)
+	return ""
+}
+
+func tmValidatorSetHash(validators []*tmtypes.Validator) []byte {
+	return tmtypes.NewValidatorSet(validators).Hash()
+}
@@ -0,0 +1,21 @@
+package network_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChihuahuaChain/chihuahua/testutil/network"
+)
+
+// TestNewIBCTestingSetupBootsConcurrentChains only exercises the boot/
+// teardown sequence, not a full handshake - NewIBCTestingSetup previously
+// deadlocked the moment a second chain was requested, because it booted
+// each chain through cosmos-sdk's network.New, which takes a package-level
+// lock it only releases from a Cleanup that can't run until this test
+// function returns. If this test hangs instead of completing, that
+// regression is back.
+func TestNewIBCTestingSetupBootsConcurrentChains(t *testing.T) {
+	setup := network.NewIBCTestingSetup(t, 2, network.DefaultConfig())
+	require.Len(t, setup.Chains, 2)
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/testutil/network"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
 	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/tendermint/spm/cosmoscmd"
 	tmrand "github.com/tendermint/tendermint/libs/rand"
@@ -27,26 +29,118 @@ type (
 	Config  = network.Config
 )
 
+// GenesisAccount describes an account New should pre-fund at genesis. If
+// Coins is left empty, the account receives the legacy default amount of
+// "<name>token" and the bond denom that WithGenesisAccountNames relies on.
+// Setting VestingEndTime turns the account into a delayed vesting account
+// that unlocks Coins in full at that unix time, instead of a plain
+// BaseAccount.
+type GenesisAccount struct {
+	Name           string
+	Coins          sdk.Coins
+	VestingEndTime int64
+}
+
+// buildConfig accumulates a network.Config together with the genesis
+// accounts Options ask for; Options close over it rather than over
+// network.Config directly because funding an account also needs the
+// keyring New creates.
+type buildConfig struct {
+	network.Config
+	genesisAccounts []GenesisAccount
+}
+
+// Option configures the network New boots, beyond what a bare
+// network.Config can express on its own.
+type Option func(*buildConfig)
+
+// WithValidators overrides the single-validator default with an n-validator
+// set.
+func WithValidators(n int) Option {
+	return func(bc *buildConfig) {
+		bc.NumValidators = n
+	}
+}
+
+// WithModuleGenesis overwrites the named module's genesis fragment wholesale,
+// letting callers exercise custom gov/slashing/distribution params without
+// copy-pasting DefaultConfig.
+func WithModuleGenesis(name string, state json.RawMessage) Option {
+	return func(bc *buildConfig) {
+		bc.GenesisState[name] = state
+	}
+}
+
+// WithGenesisAccounts pre-funds the given accounts at genesis, in addition
+// to any already present in the config's GenesisState.
+func WithGenesisAccounts(accounts ...GenesisAccount) Option {
+	return func(bc *buildConfig) {
+		bc.genesisAccounts = append(bc.genesisAccounts, accounts...)
+	}
+}
+
+// WithGenesisAccountNames is shorthand for WithGenesisAccounts when callers
+// just want the legacy fixed-amount accounts New used to create from a
+// plain list of names.
+func WithGenesisAccountNames(names ...string) Option {
+	accounts := make([]GenesisAccount, len(names))
+	for i, name := range names {
+		accounts[i] = GenesisAccount{Name: name}
+	}
+	return WithGenesisAccounts(accounts...)
+}
+
+// WithValidatorStakes overrides the account/staking/bonded token amounts
+// DefaultConfig otherwise hardcodes for every validator. There is no
+// per-validator variant of this option: cosmos-sdk's network.New applies a
+// single Config.BondedTokens (and AccountTokens/StakingTokens) value across
+// every validator it boots in one loop, with no hook to vary it by index
+// short of forking New() itself - which would also mean replacing New's
+// *network.Network return type below, since Validator's Tendermint node
+// handle is unexported and can't be populated from outside cosmos-sdk's
+// package. Module account permissions (maccPerms) have the same problem
+// one layer further down: they're a package-level var baked into app.New
+// in the app package, which doesn't take them as a parameter, so there is
+// no Option that can reach them either without changing app.New's
+// signature first.
+func WithValidatorStakes(accountTokens, stakingTokens, bondedTokens sdk.Int) Option {
+	return func(bc *buildConfig) {
+		bc.AccountTokens = accountTokens
+		bc.StakingTokens = stakingTokens
+		bc.BondedTokens = bondedTokens
+	}
+}
+
 // New creates instance with fully configured cosmos network.
-// Accepts optional config, that will be used in place of the DefaultConfig() if provided.
-func New(t *testing.T, config network.Config, genAccNames ...string) (*network.Network, keyring.Keyring) {
+// Accepts a base config, which opts may further customize (validator count,
+// module genesis overrides, pre-funded accounts) before the network boots.
+//
+// BREAKING: this replaced the previous New(t, config, genAccNames ...string)
+// signature. Callers passing plain account names positionally no longer
+// compile; migrate them to New(t, config, WithGenesisAccountNames(names...)).
+func New(t *testing.T, config network.Config, opts ...Option) (*network.Network, keyring.Keyring) {
+	bc := &buildConfig{Config: config}
+	for _, opt := range opts {
+		opt(bc)
+	}
+
 	kr := generateKeyring(t)
 
 	// add genesis accounts
-	genAuthAccs := make([]authtypes.GenesisAccount, len(genAccNames))
-	genBalances := make([]banktypes.Balance, len(genAccNames))
-	for i, name := range genAccNames {
-		a, b := newGenAccout(kr, name, 1000000000000)
+	genAuthAccs := make([]authtypes.GenesisAccount, len(bc.genesisAccounts))
+	genBalances := make([]banktypes.Balance, len(bc.genesisAccounts))
+	for i, acc := range bc.genesisAccounts {
+		a, b := newGenAccountFromSpec(kr, acc)
 		genAuthAccs[i] = a
 		genBalances[i] = b
 	}
 
-	config, err := addGenAccounts(config, genAuthAccs, genBalances)
+	cfg, err := addGenAccounts(bc.Config, genAuthAccs, genBalances)
 	if err != nil {
 		panic(err)
 	}
 
-	net := network.New(t, config)
+	net := network.New(t, cfg)
 	t.Cleanup(net.Cleanup)
 	return net, kr
 }
@@ -109,29 +203,43 @@ func addGenAccounts(cfg network.Config, genAccounts []authtypes.GenesisAccount,
 	return cfg, nil
 }
 
-func newGenAccout(kr keyring.Keyring, name string, amount int64) (authtypes.GenesisAccount, banktypes.Balance) {
-	info, mnm, err := kr.NewMnemonic(name, keyring.English, "", "", hd.Secp256k1)
+// newGenAccountFromSpec creates a keyring entry for spec.Name and returns
+// the genesis account and balance it should be funded with. Coins defaults
+// to the legacy fixed amount of "<name>token" and the bond denom when
+// spec.Coins is empty, and the account becomes a delayed vesting account
+// when spec.VestingEndTime is set.
+func newGenAccountFromSpec(kr keyring.Keyring, spec GenesisAccount) (authtypes.GenesisAccount, banktypes.Balance) {
+	const defaultAmount = 1000000000000
+
+	info, mnm, err := kr.NewMnemonic(spec.Name, keyring.English, "", "", hd.Secp256k1)
 	if err != nil {
 		panic(err)
 	}
 
-	_, err = kr.NewAccount(name, mnm, "1234", "", hd.Secp256k1)
+	_, err = kr.NewAccount(spec.Name, mnm, "1234", "", hd.Secp256k1)
 	if err != nil {
 		panic(err)
 	}
 
-	// create coin
-	balances := sdk.NewCoins(
-		sdk.NewCoin(fmt.Sprintf("%stoken", name), sdk.NewInt(amount)),
-		sdk.NewCoin(sdk.DefaultBondDenom, sdk.NewInt(amount)),
-	)
+	coins := spec.Coins
+	if coins.Empty() {
+		coins = sdk.NewCoins(
+			sdk.NewCoin(fmt.Sprintf("%stoken", spec.Name), sdk.NewInt(defaultAmount)),
+			sdk.NewCoin(sdk.DefaultBondDenom, sdk.NewInt(defaultAmount)),
+		)
+	}
 
 	bal := banktypes.Balance{
 		Address: info.GetAddress().String(),
-		Coins:   balances.Sort(),
+		Coins:   coins.Sort(),
+	}
+
+	baseAcc := authtypes.NewBaseAccount(info.GetAddress(), info.GetPubKey(), 0, 0)
+	if spec.VestingEndTime == 0 {
+		return baseAcc, bal
 	}
 
-	return authtypes.NewBaseAccount(info.GetAddress(), info.GetPubKey(), 0, 0), bal
+	return vestingtypes.NewDelayedVestingAccount(baseAcc, coins, spec.VestingEndTime), bal
 }
 
 func generateKeyring(t *testing.T) keyring.Keyring {
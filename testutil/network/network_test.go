@@ -0,0 +1,34 @@
+package network_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChihuahuaChain/chihuahua/testutil/network"
+)
+
+// TestWithValidatorStakesOverridesDefaults checks that WithValidatorStakes'
+// account token amount actually reaches the booted validator's genesis
+// balance, instead of DefaultConfig's hardcoded 1000-power amount.
+func TestWithValidatorStakesOverridesDefaults(t *testing.T) {
+	accountTokens := sdk.TokensFromConsensusPower(2000, sdk.DefaultPowerReduction)
+	stakingTokens := sdk.TokensFromConsensusPower(900, sdk.DefaultPowerReduction)
+	bondedTokens := sdk.TokensFromConsensusPower(300, sdk.DefaultPowerReduction)
+
+	cfg := network.DefaultConfig()
+	net, _ := network.New(t, cfg, network.WithValidatorStakes(accountTokens, stakingTokens, bondedTokens))
+	require.NoError(t, net.WaitForNextBlock())
+
+	val := net.Validators[0]
+	resp, err := banktypes.NewQueryClient(val.ClientCtx).Balance(context.Background(), &banktypes.QueryBalanceRequest{
+		Address: val.Address.String(),
+		Denom:   fmt.Sprintf("%stoken", val.Moniker),
+	})
+	require.NoError(t, err)
+	require.Equal(t, accountTokens, resp.Balance.Amount)
+}